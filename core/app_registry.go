@@ -0,0 +1,98 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/robertkrimen/otto"
+)
+
+// AppFactory builds an App from a location's app configuration.  cfg
+// is whatever a Location's AppConfig holds, typically the decoded
+// body of its "app" configuration block.
+type AppFactory func(cfg map[string]interface{}) (App, error)
+
+var (
+	appRegistryMu sync.Mutex
+	appRegistry   = make(map[string]AppFactory)
+)
+
+// RegisterApp makes an App implementation available under name for
+// later lookup via NewApp.  It's meant to be called from an init()
+// function, the same way database/sql drivers register themselves,
+// so experimental App behaviors can ship as independent packages and
+// be enabled per location without recompiling the server.
+func RegisterApp(name string, factory AppFactory) {
+	appRegistryMu.Lock()
+	defer appRegistryMu.Unlock()
+	if factory == nil {
+		panic("core: RegisterApp factory is nil for " + name)
+	}
+	if _, dup := appRegistry[name]; dup {
+		panic("core: RegisterApp called twice for " + name)
+	}
+	appRegistry[name] = factory
+}
+
+// NewApp looks up the App factory registered under name and calls it
+// with cfg.  A Location selects its App this way via its AppName and
+// AppConfig fields.
+func NewApp(name string, cfg map[string]interface{}) (App, error) {
+	appRegistryMu.Lock()
+	factory, ok := appRegistry[name]
+	appRegistryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("core: no App registered under %q", name)
+	}
+	return factory(cfg)
+}
+
+// CompositeApp chains several App implementations into one: headers
+// are merged in order (later apps can override earlier ones),
+// bindings pass through each app's ProcessBindings in turn, and every
+// app gets a chance to install itself into the Javascript runtime.
+type CompositeApp struct {
+	Apps []App
+}
+
+func (c *CompositeApp) GenerateHeaders(ctx *Context) map[string]string {
+	headers := make(map[string]string)
+	for _, app := range c.Apps {
+		for k, v := range app.GenerateHeaders(ctx) {
+			headers[k] = v
+		}
+	}
+	return headers
+}
+
+func (c *CompositeApp) ProcessBindings(ctx *Context, bs Bindings) Bindings {
+	for _, app := range c.Apps {
+		bs = app.ProcessBindings(ctx, bs)
+	}
+	return bs
+}
+
+func (c *CompositeApp) UpdateJavascriptRuntime(ctx *Context, runtime *otto.Otto) error {
+	for _, app := range c.Apps {
+		if err := app.UpdateJavascriptRuntime(ctx, runtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+import (
+	"testing"
+
+	"github.com/robertkrimen/otto"
+)
+
+type fakeApp struct {
+	cfg map[string]interface{}
+}
+
+func (a *fakeApp) GenerateHeaders(ctx *Context) map[string]string { return nil }
+func (a *fakeApp) ProcessBindings(ctx *Context, bs Bindings) Bindings {
+	return bs
+}
+func (a *fakeApp) UpdateJavascriptRuntime(ctx *Context, runtime *otto.Otto) error {
+	return nil
+}
+
+func TestSetLocResolvesRegisteredApp(t *testing.T) {
+	const name = "test-set-loc-app"
+	var gotCfg map[string]interface{}
+	RegisterApp(name, func(cfg map[string]interface{}) (App, error) {
+		gotCfg = cfg
+		return &fakeApp{cfg: cfg}, nil
+	})
+
+	ctx := TestContext("test")
+	loc := &Location{AppName: name, AppConfig: map[string]interface{}{"k": "v"}}
+	ctx.SetLoc(loc)
+
+	app, ok := ctx.App.(*fakeApp)
+	if !ok {
+		t.Fatalf("expected ctx.App to be set from the registered factory, got %T", ctx.App)
+	}
+	if gotCfg["k"] != "v" {
+		t.Fatalf("expected AppConfig to be passed through to the factory, got %v", gotCfg)
+	}
+	if app.cfg["k"] != "v" {
+		t.Fatalf("expected fakeApp to retain its config, got %v", app.cfg)
+	}
+}
+
+func TestSetLocLeavesAppUnchangedOnLookupFailure(t *testing.T) {
+	ctx := TestContext("test")
+	existing := &fakeApp{}
+	ctx.App = existing
+
+	ctx.SetLoc(&Location{AppName: "test-set-loc-app-does-not-exist"})
+
+	if ctx.App != existing {
+		t.Fatalf("expected ctx.App to be left unchanged after a lookup failure, got %v", ctx.App)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/robertkrimen/otto"
 )
@@ -44,6 +45,47 @@ type Tracer interface {
 	// StopSpan is given a context previously given to StartSpan in order to
 	// finalize the trace for the given span.
 	StopSpan(ctx *Context)
+
+	// Inject serializes the span context carried by ctx into carrier
+	// so it can cross a process boundary: an outbound HTTP action
+	// call, a queued event, or a Javascript-triggered rule.
+	Inject(ctx *Context, carrier map[string]string)
+
+	// Extract reconstructs a Context carrying the span context
+	// encoded in carrier, as previously produced by Inject.  The
+	// returned Context is meant to seed StartSpan on the receiving
+	// side so the new span nests under the caller's span.
+	Extract(carrier map[string]string) *Context
+}
+
+// SpanContext is an opaque handle to tracer-specific span state.  A
+// Tracer stores whatever it needs here via SetSpanContext (from
+// StartSpan/Extract) and reads it back via Context.SpanContext(); the
+// core package never looks inside it.
+type SpanContext interface{}
+
+// Metrics can be used to record counters, gauges, and timing/size
+// samples for rule evaluation, action execution, and store
+// operations.  Implementations must be safe for concurrent use, since
+// a single Metrics is shared by a Context and all of its SubContexts.
+type Metrics interface {
+	// IncrCounter increments the counter named by key by v.  labels
+	// are attached to the resulting observation for dimensionality
+	// (e.g. location, ruleId) and may be nil.
+	IncrCounter(key []string, v float32, labels map[string]string)
+
+	// SetGauge sets the gauge named by key to v.
+	SetGauge(key []string, v float32, labels map[string]string)
+
+	// AddSample records v as an observation in the timing/size
+	// distribution named by key.
+	AddSample(key []string, v float32, labels map[string]string)
+
+	// MeasureSince records the elapsed time since start as a sample
+	// for key.  It's typically used with defer:
+	//
+	//   defer ctx.Metrics.MeasureSince([]string{"rule", "eval"}, time.Now(), nil)
+	MeasureSince(key []string, start time.Time, labels map[string]string)
 }
 
 type Context struct {
@@ -85,6 +127,26 @@ type Context struct {
 	// Custom application tracing
 	Tracer Tracer
 
+	// Metrics, if not nil, receives counters/gauges/samples for rule
+	// evaluation, action execution, and store operations.  It's
+	// carried into SubContexts so child spans report to the same
+	// sink as their parent.
+	Metrics Metrics
+
+	// span holds whatever Tracer.StartSpan/Extract stashed here so
+	// that a child SubContext nests under it rather than starting a
+	// sibling span.
+	span SpanContext
+
+	// Quota, if not nil, bounds the resources (rules, facts storage,
+	// event rate, JS runtime, action fanout) the target location may
+	// consume.  See CheckQuota.
+	Quota *Quota
+
+	// QuotaStore backs CheckQuota's reservations.  A nil QuotaStore
+	// falls back to an in-memory default.
+	QuotaStore QuotaStore
+
 	// Functionality previous residing in csv-context-go/Context
 
 	Logger   Logger
@@ -104,8 +166,33 @@ type Context struct {
 	privilege string
 }
 
+// SetLoc assigns loc as ctx's target location.  If loc names an App
+// via AppName, SetLoc resolves it through the App registry
+// (RegisterApp/NewApp) and assigns the result to c.App, so each
+// location can be served by a different, independently registered App
+// implementation chosen by configuration rather than by recompiling
+// the server.  A lookup failure is logged and leaves c.App unchanged.
+// It also copies loc's Quota/QuotaStore onto c, the same way App is
+// picked up, so per-location quotas are enforced without every caller
+// having to remember to copy them over by hand.
 func (c *Context) SetLoc(loc *Location) *Location {
 	c.location.Store(loc)
+	if loc != nil {
+		if loc.AppName != "" {
+			app, err := NewApp(loc.AppName, loc.AppConfig)
+			if err != nil {
+				c.Log(ANYWARN, "SetLoc", "error", err, "appName", loc.AppName)
+			} else {
+				c.App = app
+			}
+		}
+		if loc.Quota != nil {
+			c.Quota = loc.Quota
+		}
+		if loc.QuotaStore != nil {
+			c.QuotaStore = loc.QuotaStore
+		}
+	}
 	return loc
 }
 
@@ -213,6 +300,33 @@ func (ctx *Context) SetLogValue(name string, val interface{}) {
 	ctx.logProps[name] = val
 }
 
+// LogProps returns a copy of this Context's log properties (e.g.
+// location, ruleId, eventId), for consumers like a Tracer that want
+// to attach them as span attributes without reaching into Context
+// internals.
+func (ctx *Context) LogProps() map[string]interface{} {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	props := make(map[string]interface{}, len(ctx.logProps))
+	for k, v := range ctx.logProps {
+		props[k] = v
+	}
+	return props
+}
+
+// SpanContext returns whatever the active Tracer stashed via
+// SetSpanContext, or nil if no span is in progress.
+func (ctx *Context) SpanContext() SpanContext {
+	return ctx.span
+}
+
+// SetSpanContext is called by a Tracer's StartSpan/Extract to record
+// span state on ctx so that it can be nested by child SubContexts and
+// later read back by StopSpan/Inject.
+func (ctx *Context) SetSpanContext(span SpanContext) {
+	ctx.span = span
+}
+
 func (ctx *Context) SubContext() *Context {
 	ctx.RLock()
 
@@ -229,6 +343,10 @@ func (ctx *Context) SubContext() *Context {
 		privilege:           ctx.privilege,
 		Ctx:                 ctx.Ctx,
 		Tracer:              ctx.Tracer,
+		Metrics:             ctx.Metrics,
+		span:                ctx.span,
+		Quota:               ctx.Quota,
+		QuotaStore:          ctx.QuotaStore,
 	}
 
 	sub.SetLoc(ctx.GetLoc())
@@ -259,19 +377,40 @@ func (ctx *Context) StopSpan() {
 	}
 }
 
+// InjectTraceHeaders adds traceparent/tracestate (or whatever the
+// active Tracer uses) to headers, so outbound HTTP actions propagate
+// the current span across the network call.  It's a no-op when no
+// Tracer is configured.
+func (ctx *Context) InjectTraceHeaders(headers map[string]string) {
+	if ctx.Tracer != nil {
+		ctx.Tracer.Inject(ctx, headers)
+	}
+}
+
 func BenchContext(appId string) *Context {
 	// ctx := context.NewContext(ioutil.Discard)
 	// ctx.AddLogValue("app.id", prefix)
 	ctx := newContext(appId)
 	ctx.Verbosity = NOTHING
-	ctx.Logger = BenchLogger
+	ctx.Logger = benchJSONLogger
 	ctx.LogAccumulatorLevel = NOTHING
 	return ctx
 }
 
+// ContextAwareLogger is implemented by loggers, like JSONLogger, that
+// want the full Context rather than just the level/op/args trio
+// Logger gets, so they can report ctxId and the merged logProps.
+type ContextAwareLogger interface {
+	Logger
+
+	LogContext(ctx *Context, level LogLevel, op string, args []interface{})
+}
+
 func (ctx *Context) Log(level LogLevel, op string, args ...interface{}) {
 	if ctx == nil || ctx.Logger == nil {
 		DefaultLogger.Log(level, args)
+	} else if cal, ok := ctx.Logger.(ContextAwareLogger); ok {
+		cal.LogContext(ctx, level, op, args)
 	} else {
 		ctx.Logger.Log(level, op, args)
 	}
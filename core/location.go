@@ -0,0 +1,46 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+// Location is a single target of rule evaluation: its own rule/fact
+// storage, reachable from a Context via SetLoc/GetLoc.
+type Location struct {
+	// Mode controls read/write access to this location; see
+	// Context.ReadKey/WriteKey.
+	Mode *LocationMode
+
+	// AppName, if not empty, selects the App that serves this
+	// location via the App registry (RegisterApp/NewApp); AppConfig
+	// is passed through to the registered factory.  SetLoc resolves
+	// this automatically.
+	AppName   string
+	AppConfig map[string]interface{}
+
+	// Quota, if not nil, bounds the resources this location may
+	// consume; see Context.CheckQuota.  QuotaStore, if not nil,
+	// persists this location's quota usage.  SetLoc copies both onto
+	// the Context automatically.
+	Quota      *Quota
+	QuotaStore QuotaStore
+}
+
+// LocationMode gates read/write access to a Location.  A nil
+// ReadKey/WriteKey means the corresponding API requires no key.
+type LocationMode struct {
+	ReadKey  *string
+	WriteKey *string
+}
@@ -0,0 +1,222 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// defaultJSONBufSize is the size-bounded write buffer JSONLogger uses
+// when a caller doesn't specify one: enough to amortize syscall cost
+// under high rule throughput without holding records too long.
+const defaultJSONBufSize = 4096
+
+// jsonRecord is the wire format JSONLogger emits: one JSON object per
+// log record.
+type jsonRecord struct {
+	Ts    string                 `json:"ts"`
+	Level string                 `json:"level"`
+	Op    string                 `json:"op"`
+	CtxId string                 `json:"ctxId,omitempty"`
+	Props map[string]interface{} `json:"props,omitempty"`
+	KV    map[string]interface{} `json:"kv,omitempty"`
+}
+
+// JSONLogger is a structured logger that emits one JSON object per
+// record, with ts/level/op/ctxId fields plus ctx's merged logProps
+// and any string/value pairs found in args.  Info/debug records go to
+// out; warn/error records go to errOut, so the two streams can be
+// routed (or sampled) independently, e.g. stdout vs stderr.  Use the
+// same io.Writer for both to disable the split.
+type JSONLogger struct {
+	out, errOut *bufWriter
+}
+
+// NewJSONLogger returns a JSONLogger writing info/debug records to
+// out and warn/error records to errOut.  Writes are buffered up to
+// bufSize bytes per stream and flushed on overflow or once per
+// second, whichever comes first; bufSize <= 0 uses
+// defaultJSONBufSize.
+func NewJSONLogger(out, errOut io.Writer, bufSize int) *JSONLogger {
+	if bufSize <= 0 {
+		bufSize = defaultJSONBufSize
+	}
+	return &JSONLogger{
+		out:    newBufWriter(out, bufSize, time.Second),
+		errOut: newBufWriter(errOut, bufSize, time.Second),
+	}
+}
+
+// benchJSONLogger is what BenchContext uses: a JSONLogger pointed at
+// ioutil.Discard, so microbenchmarks still pay for marshaling and
+// buffering rather than reflecting a silent no-op logger.
+var benchJSONLogger = NewJSONLogger(ioutil.Discard, ioutil.Discard, defaultJSONBufSize)
+
+// Close flushes both streams and stops their periodic-flush
+// goroutines.  Callers that replace a Context's Logger at runtime
+// should Close the old one to avoid leaking it.
+func (l *JSONLogger) Close() {
+	l.out.Close()
+	l.errOut.Close()
+}
+
+// Log implements Logger without context; ctxId and logProps are left
+// empty since there's no Context to pull them from.
+func (l *JSONLogger) Log(level LogLevel, op string, args []interface{}) {
+	l.write(level, "", nil, op, args)
+}
+
+// LogContext implements ContextAwareLogger, so Context.Log routes
+// through here when the active Logger is a *JSONLogger.
+func (l *JSONLogger) LogContext(ctx *Context, level LogLevel, op string, args []interface{}) {
+	var ctxId string
+	var props map[string]interface{}
+	if ctx != nil {
+		ctxId = ctx.Id()
+		props = ctx.LogProps()
+	}
+	l.write(level, ctxId, props, op, args)
+}
+
+func (l *JSONLogger) write(level LogLevel, ctxId string, props map[string]interface{}, op string, args []interface{}) {
+	rec := jsonRecord{
+		Ts:    time.Now().UTC().Format(time.RFC3339Nano),
+		Level: fmt.Sprint(level),
+		Op:    op,
+		CtxId: ctxId,
+		Props: props,
+		KV:    kvPairs(args),
+	}
+
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		// Either a kv pair or a logProps value wasn't marshalable;
+		// rather than drop the record entirely, fall back to one
+		// without either so the ts/level/op/ctxId still make it out.
+		rec.Props = nil
+		rec.KV = map[string]interface{}{"marshalErr": err.Error()}
+		buf, err = json.Marshal(rec)
+		if err != nil {
+			return
+		}
+	}
+	buf = append(buf, '\n')
+
+	if isErrLevel(level) {
+		l.errOut.Write(buf)
+	} else {
+		l.out.Write(buf)
+	}
+}
+
+// isErrLevel reports whether level is severe enough to route to the
+// error stream.  ANYWARN is rulio's existing "warn or worse"
+// threshold, used elsewhere as the default LogAccumulatorLevel.
+func isErrLevel(level LogLevel) bool {
+	return level <= ANYWARN
+}
+
+// kvPairs extracts string/value pairs from args, mirroring how the
+// text logger already expects args to be laid out: alternating key,
+// value, key, value...  A trailing unpaired argument is dropped.
+func kvPairs(args []interface{}) map[string]interface{} {
+	if len(args) < 2 {
+		return nil
+	}
+	kv := make(map[string]interface{}, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			continue
+		}
+		kv[key] = args[i+1]
+	}
+	if len(kv) == 0 {
+		return nil
+	}
+	return kv
+}
+
+// bufWriter accumulates writes up to size bytes, flushing to out on
+// overflow or every flushEvery, whichever happens first.  It exists
+// so JSONLogger can amortize syscall cost under high rule throughput.
+type bufWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	buf    bytes.Buffer
+	size   int
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+func newBufWriter(out io.Writer, size int, flushEvery time.Duration) *bufWriter {
+	w := &bufWriter{out: out, size: size}
+	if flushEvery > 0 {
+		w.ticker = time.NewTicker(flushEvery)
+		w.done = make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-w.ticker.C:
+					w.Flush()
+				case <-w.done:
+					return
+				}
+			}
+		}()
+	}
+	return w
+}
+
+// Close flushes any buffered data and stops the periodic-flush
+// goroutine, if one was started.
+func (w *bufWriter) Close() {
+	if w.ticker != nil {
+		w.ticker.Stop()
+		close(w.done)
+	}
+	w.Flush()
+}
+
+func (w *bufWriter) Write(p []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	if w.buf.Len() >= w.size {
+		w.flushLocked()
+	}
+}
+
+func (w *bufWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushLocked()
+}
+
+func (w *bufWriter) flushLocked() {
+	if w.buf.Len() == 0 {
+		return
+	}
+	w.out.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
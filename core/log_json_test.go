@@ -0,0 +1,70 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type unmarshalableLogProp struct{}
+
+var errUnmarshalableLogProp = errors.New("cannot marshal this log prop")
+
+func (unmarshalableLogProp) MarshalJSON() ([]byte, error) {
+	return nil, errUnmarshalableLogProp
+}
+
+func TestJSONLoggerFallsBackOnBadLogProp(t *testing.T) {
+	var out bytes.Buffer
+	l := NewJSONLogger(&out, &out, 0)
+
+	ctx := TestContext("test")
+	ctx.SetLogValue("bad", unmarshalableLogProp{})
+
+	l.LogContext(ctx, ANYWARN, "some-op", []interface{}{"k", "v"})
+	l.Close()
+
+	got := out.String()
+	if got == "" {
+		t.Fatalf("expected a fallback record to be written, not dropped entirely")
+	}
+	if !strings.Contains(got, "marshalErr") {
+		t.Fatalf("expected fallback record to carry marshalErr, got %q", got)
+	}
+	if !strings.Contains(got, `"op":"some-op"`) {
+		t.Fatalf("expected fallback record to still carry ts/level/op/ctxId, got %q", got)
+	}
+}
+
+func TestJSONLoggerFallsBackOnBadKV(t *testing.T) {
+	var out bytes.Buffer
+	l := NewJSONLogger(&out, &out, 0)
+
+	l.Log(ANYWARN, "some-op", []interface{}{"bad", unmarshalableLogProp{}})
+	l.Close()
+
+	got := out.String()
+	if got == "" {
+		t.Fatalf("expected a fallback record to be written, not dropped entirely")
+	}
+	if !strings.Contains(got, "marshalErr") {
+		t.Fatalf("expected fallback record to carry marshalErr, got %q", got)
+	}
+}
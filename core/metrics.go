@@ -0,0 +1,284 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reservoirSize bounds how many observations a sample keeps around in
+// order to estimate quantiles.  This is the same tradeoff
+// armon/go-metrics makes: enough samples for a stable P99 without
+// retaining every observation.
+const reservoirSize = 512
+
+// sample is a small, concurrency-safe reservoir (Algorithm R) used to
+// estimate P50/P90/P99 for a timing or size distribution.
+type sample struct {
+	mu     sync.Mutex
+	seen   int64
+	values []float32
+}
+
+func (s *sample) observe(v float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	if len(s.values) < reservoirSize {
+		s.values = append(s.values, v)
+		return
+	}
+	if j := rand.Int63n(s.seen); j < reservoirSize {
+		s.values[j] = v
+	}
+}
+
+// percentiles returns the requested quantiles (each in [0, 1]) over
+// the current reservoir.  It's a point-in-time snapshot, so callers
+// that need a stable view should only call it once per report.
+func (s *sample) percentiles(qs ...float64) []float32 {
+	s.mu.Lock()
+	values := append([]float32(nil), s.values...)
+	s.mu.Unlock()
+
+	if len(values) == 0 {
+		return make([]float32, len(qs))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	out := make([]float32, len(qs))
+	for i, q := range qs {
+		idx := int(q * float64(len(values)-1))
+		out[i] = values[idx]
+	}
+	return out
+}
+
+// metricPoint is the aggregate for one key+labels combination within
+// a single interval.
+type metricPoint struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Count  int64             `json:"count"`
+	Sum    float64           `json:"sum"`
+	Min    float32           `json:"min"`
+	Max    float32           `json:"max"`
+	Last   float32           `json:"last"`
+
+	sample *sample // only populated for AddSample/MeasureSince points
+}
+
+// MarshalJSON includes the P50/P90/P99 estimate for points that have
+// a reservoir of observations (AddSample/MeasureSince), in addition
+// to the plain count/sum/min/max every point carries.
+func (p *metricPoint) MarshalJSON() ([]byte, error) {
+	type alias metricPoint
+	out := struct {
+		*alias
+		P50 float32 `json:"p50,omitempty"`
+		P90 float32 `json:"p90,omitempty"`
+		P99 float32 `json:"p99,omitempty"`
+	}{alias: (*alias)(p)}
+	if p.sample != nil {
+		qs := p.sample.percentiles(0.5, 0.9, 0.99)
+		out.P50, out.P90, out.P99 = qs[0], qs[1], qs[2]
+	}
+	return json.Marshal(out)
+}
+
+func (p *metricPoint) observe(v float32) {
+	p.Count++
+	p.Sum += float64(v)
+	p.Last = v
+	if p.Count == 1 || v < p.Min {
+		p.Min = v
+	}
+	if p.Count == 1 || v > p.Max {
+		p.Max = v
+	}
+}
+
+// IntervalMetrics holds every counter/gauge/sample observed during a
+// single fixed-duration bucket.
+type IntervalMetrics struct {
+	sync.RWMutex `json:"-"`
+
+	Interval time.Time `json:"interval"`
+
+	Counters map[string]*metricPoint `json:"counters"`
+	Gauges   map[string]*metricPoint `json:"gauges"`
+	Samples  map[string]*metricPoint `json:"samples"`
+}
+
+func newIntervalMetrics(t time.Time) *IntervalMetrics {
+	return &IntervalMetrics{
+		Interval: t,
+		Counters: make(map[string]*metricPoint),
+		Gauges:   make(map[string]*metricPoint),
+		Samples:  make(map[string]*metricPoint),
+	}
+}
+
+// MarshalJSON RLocks im before walking its maps, so serializing a
+// live interval (from ServeHTTP or the SIGUSR1 dump) can't race with
+// a concurrent IncrCounter/SetGauge/AddSample on the same bucket.
+func (im *IntervalMetrics) MarshalJSON() ([]byte, error) {
+	im.RLock()
+	defer im.RUnlock()
+
+	type alias IntervalMetrics
+	return json.Marshal((*alias)(im))
+}
+
+func pointKey(key []string, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(strings.Join(key, "."))
+	if len(labels) > 0 {
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			b.WriteString(";")
+			b.WriteString(k)
+			b.WriteString("=")
+			b.WriteString(labels[k])
+		}
+	}
+	return b.String()
+}
+
+func (im *IntervalMetrics) point(bucket map[string]*metricPoint, key []string, labels map[string]string) *metricPoint {
+	k := pointKey(key, labels)
+	im.Lock()
+	defer im.Unlock()
+	p, ok := bucket[k]
+	if !ok {
+		p = &metricPoint{Name: strings.Join(key, "."), Labels: labels}
+		bucket[k] = p
+	}
+	return p
+}
+
+// InmemSink is a built-in Metrics implementation that keeps a ring of
+// fixed-duration intervals (the pattern from armon/go-metrics), each
+// holding per-key count/sum/min/max/Pxx aggregates.  It needs no
+// external dependency.  A Context does not get one automatically:
+// Context.Metrics stays nil until one is assigned.
+type InmemSink struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	intervals []*IntervalMetrics // oldest first
+	maxKept   int
+}
+
+// NewInmemSink creates a sink that buckets observations into
+// interval-sized windows and retains up to numBuckets of them (e.g.
+// 60 one-second buckets for a rolling minute of history).
+func NewInmemSink(interval time.Duration, numBuckets int) *InmemSink {
+	if numBuckets < 1 {
+		numBuckets = 1
+	}
+	return &InmemSink{interval: interval, maxKept: numBuckets}
+}
+
+func (s *InmemSink) currentInterval() *IntervalMetrics {
+	now := time.Now().Truncate(s.interval)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.intervals); n > 0 && s.intervals[n-1].Interval.Equal(now) {
+		return s.intervals[n-1]
+	}
+	im := newIntervalMetrics(now)
+	s.intervals = append(s.intervals, im)
+	if len(s.intervals) > s.maxKept {
+		s.intervals = s.intervals[len(s.intervals)-s.maxKept:]
+	}
+	return im
+}
+
+func (s *InmemSink) IncrCounter(key []string, v float32, labels map[string]string) {
+	im := s.currentInterval()
+	p := im.point(im.Counters, key, labels)
+	im.Lock()
+	p.observe(v)
+	im.Unlock()
+}
+
+func (s *InmemSink) SetGauge(key []string, v float32, labels map[string]string) {
+	im := s.currentInterval()
+	p := im.point(im.Gauges, key, labels)
+	im.Lock()
+	p.Last = v
+	im.Unlock()
+}
+
+func (s *InmemSink) AddSample(key []string, v float32, labels map[string]string) {
+	im := s.currentInterval()
+	p := im.point(im.Samples, key, labels)
+	im.Lock()
+	if p.sample == nil {
+		p.sample = &sample{}
+	}
+	p.observe(v)
+	sm := p.sample
+	im.Unlock()
+	sm.observe(v)
+}
+
+func (s *InmemSink) MeasureSince(key []string, start time.Time, labels map[string]string) {
+	elapsedMs := float32(time.Since(start)) / float32(time.Millisecond)
+	s.AddSample(key, elapsedMs, labels)
+}
+
+// Data returns a snapshot of the retained intervals, oldest first.
+func (s *InmemSink) Data() []*IntervalMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*IntervalMetrics, len(s.intervals))
+	copy(out, s.intervals)
+	return out
+}
+
+// ServeHTTP serializes the current and previous interval as JSON, so
+// an operator (or a scraper) can fetch a cheap, dependency-free
+// summary of recent rule throughput and tail latency.
+func (s *InmemSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := s.Data()
+	var cur, prev *IntervalMetrics
+	if n := len(data); n > 0 {
+		cur = data[n-1]
+		if n > 1 {
+			prev = data[n-2]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Current  *IntervalMetrics `json:"current"`
+		Previous *IntervalMetrics `json:"previous,omitempty"`
+	}{cur, prev})
+}
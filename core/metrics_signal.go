@@ -0,0 +1,62 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+//go:build !windows
+// +build !windows
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// EnableSignalHandler starts a goroutine that dumps the current
+// interval's metrics to stderr whenever the process receives
+// SIGUSR1, the same signal armon/go-metrics uses for this purpose.
+// Closing stop unregisters the handler and stops the goroutine.
+func (s *InmemSink) EnableSignalHandler(stop <-chan struct{}) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-sigCh:
+				s.dumpToStderr()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *InmemSink) dumpToStderr() {
+	data := s.Data()
+	if len(data) == 0 {
+		return
+	}
+	buf, err := json.MarshalIndent(data[len(data)-1], "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "metrics: %v\n", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(buf))
+}
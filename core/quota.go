@@ -0,0 +1,236 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto"
+)
+
+// Quota bounds the resources a single location may consume.  The zero
+// value for a field means "unlimited" for that resource.
+type Quota struct {
+	MaxRules           int64
+	MaxFactsBytes      int64
+	MaxEventsPerSecond int64
+	MaxJSRuntimeMillis int64
+	MaxActionFanout    int64
+}
+
+// Resource names understood by Context.CheckQuota.
+const (
+	QuotaRules        = "rules"
+	QuotaFactsBytes   = "factsBytes"
+	QuotaEvents       = "events"
+	QuotaActionFanout = "actionFanout"
+)
+
+func (q *Quota) limit(resource string) int64 {
+	if q == nil {
+		return 0
+	}
+	switch resource {
+	case QuotaRules:
+		return q.MaxRules
+	case QuotaFactsBytes:
+		return q.MaxFactsBytes
+	case QuotaEvents:
+		return q.MaxEventsPerSecond
+	case QuotaActionFanout:
+		return q.MaxActionFanout
+	default:
+		return 0
+	}
+}
+
+// QuotaStore persists quota usage.  The zero value of Context uses an
+// in-memory default, so a QuotaStore only needs to be supplied when
+// usage must survive a process restart or be shared across replicas.
+type QuotaStore interface {
+	// Reserve atomically adds delta to resource's running total and
+	// returns the new total.  Implementations must be safe for
+	// concurrent use.
+	Reserve(resource string, delta int64) int64
+}
+
+type memQuotaStore struct {
+	mu     sync.Mutex
+	totals map[string]int64
+}
+
+func newMemQuotaStore() *memQuotaStore {
+	return &memQuotaStore{totals: make(map[string]int64)}
+}
+
+func (m *memQuotaStore) Reserve(resource string, delta int64) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totals[resource] += delta
+	return m.totals[resource]
+}
+
+// defaultQuotaStore backs CheckQuota when neither ctx nor its
+// ancestors were given an explicit QuotaStore.
+var defaultQuotaStore = newMemQuotaStore()
+
+// eventWindow tracks MaxEventsPerSecond usage for a single key within
+// a single one-second window.
+type eventWindow struct {
+	start time.Time
+	count int64
+}
+
+// eventRateLimiter enforces MaxEventsPerSecond per key.  It keeps at
+// most one entry per key: the window is
+// reset in place when time rolls over to a new second, rather than
+// keyed by timestamp, so memory use is bounded by the number of
+// distinct keys (locations) rather than growing without bound over
+// time.
+type eventRateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*eventWindow
+}
+
+func newEventRateLimiter() *eventRateLimiter {
+	return &eventRateLimiter{windows: make(map[string]*eventWindow)}
+}
+
+// reserve adds delta to key's counter for the current one-second
+// window and returns the new count along with how long remains in
+// that window.
+func (r *eventRateLimiter) reserve(key string, delta int64) (count int64, remaining time.Duration) {
+	now := time.Now()
+	windowStart := now.Truncate(time.Second)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.windows[key]
+	if !ok || !w.start.Equal(windowStart) {
+		w = &eventWindow{start: windowStart}
+		r.windows[key] = w
+	}
+	w.count += delta
+	return w.count, time.Second - now.Sub(windowStart)
+}
+
+// defaultEventRateLimiter backs CheckQuota's QuotaEvents enforcement.
+var defaultEventRateLimiter = newEventRateLimiter()
+
+// QuotaExceededError is returned by Context.CheckQuota when a
+// reservation would push a resource over its configured limit.  The
+// HTTP layer maps it to 429, using RetryAfter (when non-zero) as the
+// Retry-After hint.
+type QuotaExceededError struct {
+	Resource   string
+	Limit      int64
+	Used       int64
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %d/%d", e.Resource, e.Used, e.Limit)
+}
+
+// quotaLocation returns the location identifier quota usage is scoped
+// to, taken from the "location" log prop the same way a Tracer reads
+// it for span attributes.  An empty string means "no location set";
+// every Context without one shares that single bucket, and its quota
+// is enforced there like any other.
+func (ctx *Context) quotaLocation() string {
+	loc, _ := ctx.LogProps()["location"].(string)
+	return loc
+}
+
+// CheckQuota atomically reserves delta units of resource, scoped to
+// ctx's target location, against ctx.Quota, and returns a
+// *QuotaExceededError if doing so would exceed the configured limit.
+// A nil ctx.Quota, or a zero limit for resource, means no enforcement.
+//
+// QuotaEvents is rate (per second) rather than cumulative, so it's
+// reserved against defaultEventRateLimiter instead of ctx.QuotaStore;
+// a QuotaExceededError for it carries a RetryAfter hint for the
+// remainder of the current one-second window.
+func (ctx *Context) CheckQuota(resource string, delta int64) error {
+	q := ctx.Quota
+	limit := q.limit(resource)
+	if limit <= 0 {
+		return nil
+	}
+
+	// Scope the key to the target location so that two locations
+	// with the same Quota don't share, and bleed into, each other's
+	// counters.
+	key := ctx.quotaLocation() + "|" + resource
+
+	if resource == QuotaEvents {
+		used, retryAfter := defaultEventRateLimiter.reserve(key, delta)
+		if used > limit {
+			// Release what we just reserved: a rejected reservation
+			// must not permanently inflate the counter, or every
+			// retry after a 429 would push it further over.
+			defaultEventRateLimiter.reserve(key, -delta)
+			return &QuotaExceededError{Resource: resource, Limit: limit, Used: used, RetryAfter: retryAfter}
+		}
+		return nil
+	}
+
+	store := ctx.QuotaStore
+	if store == nil {
+		store = defaultQuotaStore
+	}
+	used := store.Reserve(key, delta)
+	if used > limit {
+		store.Reserve(key, -delta)
+		return &QuotaExceededError{Resource: resource, Limit: limit, Used: used}
+	}
+	return nil
+}
+
+// jsQuotaExceeded is the value panicked with, via runtime's Interrupt
+// channel, when a script runs past its MaxJSRuntimeMillis quota.
+type jsQuotaExceeded struct {
+	limit time.Duration
+}
+
+func (e jsQuotaExceeded) Error() string {
+	return fmt.Sprintf("javascript runtime exceeded %s quota", e.limit)
+}
+
+// InstallJSTimeout arms runtime's Interrupt channel so that a script
+// running longer than limit is aborted, the pattern otto itself
+// documents for bounding script execution time.  App implementations
+// call this from UpdateJavascriptRuntime to honor
+// Quota.MaxJSRuntimeMillis.  A limit <= 0 disables the timeout.
+//
+// Code invoking runtime.Run/Eval after calling this must recover from
+// the panic and check for jsQuotaExceeded, the same way otto's own
+// halting-problem example does, or let it propagate as an error.
+func InstallJSTimeout(runtime *otto.Otto, limit time.Duration) {
+	if limit <= 0 {
+		return
+	}
+	runtime.Interrupt = make(chan func(), 1)
+	time.AfterFunc(limit, func() {
+		select {
+		case runtime.Interrupt <- func() { panic(jsQuotaExceeded{limit}) }:
+		default:
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckQuotaIsPerLocation(t *testing.T) {
+	q := &Quota{MaxRules: 2}
+
+	a := TestContext("test")
+	a.SetLogValue("location", "quota-test-a")
+	a.Quota = q
+
+	b := TestContext("test")
+	b.SetLogValue("location", "quota-test-b")
+	b.Quota = q
+
+	for i := 0; i < 2; i++ {
+		if err := a.CheckQuota(QuotaRules, 1); err != nil {
+			t.Fatalf("location a: unexpected error at rule %d: %v", i, err)
+		}
+	}
+	if err := a.CheckQuota(QuotaRules, 1); err == nil {
+		t.Fatalf("location a: expected quota error on 3rd rule")
+	}
+
+	// A rejected reservation must be rolled back: retrying after the
+	// error should keep reporting the same attempted Used (limit+1),
+	// not climb further (limit+2, +3, ...) with every failed attempt.
+	var qe *QuotaExceededError
+	for i := 0; i < 3; i++ {
+		err := a.CheckQuota(QuotaRules, 1)
+		if err == nil || !errors.As(err, &qe) {
+			t.Fatalf("location a: expected *QuotaExceededError on retry %d, got %v", i, err)
+		}
+		if qe.Used != 3 {
+			t.Fatalf("location a: rejected reservation was not rolled back: Used = %d, want 3", qe.Used)
+		}
+	}
+
+	// b has its own budget for the same Quota and must not be
+	// affected by a having already exhausted its share.
+	for i := 0; i < 2; i++ {
+		if err := b.CheckQuota(QuotaRules, 1); err != nil {
+			t.Fatalf("location b: unexpected error at rule %d: %v", i, err)
+		}
+	}
+	if err := b.CheckQuota(QuotaRules, 1); err == nil {
+		t.Fatalf("location b: expected quota error on 3rd rule")
+	}
+}
+
+func TestCheckQuotaEventsIsPerLocation(t *testing.T) {
+	q := &Quota{MaxEventsPerSecond: 1}
+
+	a := TestContext("test")
+	a.SetLogValue("location", "quota-test-events-a")
+	a.Quota = q
+
+	b := TestContext("test")
+	b.SetLogValue("location", "quota-test-events-b")
+	b.Quota = q
+
+	if err := a.CheckQuota(QuotaEvents, 1); err != nil {
+		t.Fatalf("location a: unexpected error on 1st event: %v", err)
+	}
+	if err := a.CheckQuota(QuotaEvents, 1); err == nil {
+		t.Fatalf("location a: expected quota error on 2nd event this second")
+	}
+
+	var qe *QuotaExceededError
+	for i := 0; i < 3; i++ {
+		err := a.CheckQuota(QuotaEvents, 1)
+		if err == nil || !errors.As(err, &qe) {
+			t.Fatalf("location a: expected *QuotaExceededError on retry %d, got %v", i, err)
+		}
+		if qe.Used != 2 {
+			t.Fatalf("location a: rejected reservation was not rolled back: Used = %d, want 2", qe.Used)
+		}
+	}
+
+	if err := b.CheckQuota(QuotaEvents, 1); err != nil {
+		t.Fatalf("location b: unexpected error on 1st event despite a's usage: %v", err)
+	}
+}
+
+func TestSetLocResolvesQuota(t *testing.T) {
+	q := &Quota{MaxRules: 1}
+	store := newMemQuotaStore()
+	loc := &Location{Quota: q, QuotaStore: store}
+
+	ctx := TestContext("test")
+	ctx.SetLoc(loc)
+
+	if ctx.Quota != q {
+		t.Fatalf("expected SetLoc to copy loc.Quota onto the Context")
+	}
+	if ctx.QuotaStore != store {
+		t.Fatalf("expected SetLoc to copy loc.QuotaStore onto the Context")
+	}
+
+	if err := ctx.CheckQuota(QuotaRules, 1); err != nil {
+		t.Fatalf("unexpected error on 1st rule: %v", err)
+	}
+	if err := ctx.CheckQuota(QuotaRules, 1); err == nil {
+		t.Fatalf("expected quota error on 2nd rule given MaxRules: 1")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+// Package otel implements core.Tracer on top of
+// go.opentelemetry.io/otel/trace, so rulio spans show up as ordinary
+// OpenTelemetry spans and propagate via the standard W3C tracecontext
+// carriers across HTTP actions, queued events, and Javascript-
+// triggered rules.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	rcore "github.com/decibelcooper/rulio/core"
+)
+
+// Tracer adapts an OpenTelemetry trace.Tracer to core.Tracer.  The
+// zero value is not usable; construct one with New.
+type Tracer struct {
+	tracer trace.Tracer
+	prop   propagation.TextMapPropagator
+}
+
+// New wraps tracer as a core.Tracer.  If tracer is nil, the tracer
+// registered with otel.SetTracerProvider (or a no-op, if none was
+// registered) is used, so assigning this Tracer unconditionally to
+// core.Context.Tracer is always safe.
+func New(tracer trace.Tracer) *Tracer {
+	if tracer == nil {
+		tracer = otel.Tracer("rulio")
+	}
+	return &Tracer{tracer: tracer, prop: propagation.TraceContext{}}
+}
+
+// spanState is what we stash in core.Context via SetSpanContext: the
+// go context.Context carrying the live span, plus the span itself so
+// StopSpan can end it.
+type spanState struct {
+	goCtx context.Context
+	span  trace.Span
+}
+
+func parentState(ctx *rcore.Context) (*spanState, bool) {
+	s, ok := ctx.SpanContext().(*spanState)
+	return s, ok
+}
+
+// StartSpan begins a new OpenTelemetry span as a child of whatever
+// span ctx is already carrying (from a parent SubContext or a prior
+// Extract), recording ctx's log properties (location, ruleId,
+// eventId) as span attributes.
+func (t *Tracer) StartSpan(ctx *rcore.Context, opName string) {
+	goCtx := ctx.Ctx
+	if goCtx == nil {
+		goCtx = context.Background()
+	}
+	if parent, ok := parentState(ctx); ok {
+		goCtx = parent.goCtx
+	}
+
+	goCtx, span := t.tracer.Start(goCtx, opName)
+	for k, v := range ctx.LogProps() {
+		span.SetAttributes(attribute.String(k, toString(v)))
+	}
+
+	ctx.Ctx = goCtx
+	ctx.SetSpanContext(&spanState{goCtx: goCtx, span: span})
+}
+
+// StopSpan ends the span started by StartSpan for ctx.
+func (t *Tracer) StopSpan(ctx *rcore.Context) {
+	if s, ok := parentState(ctx); ok {
+		s.span.End()
+	}
+}
+
+// Inject writes the W3C traceparent/tracestate headers for ctx's
+// current span into carrier.
+func (t *Tracer) Inject(ctx *rcore.Context, carrier map[string]string) {
+	if s, ok := parentState(ctx); ok {
+		t.prop.Inject(s.goCtx, propagation.MapCarrier(carrier))
+	}
+}
+
+// Extract rebuilds a Context carrying the span context encoded in
+// carrier (as written by Inject), ready to be handed to StartSpan so
+// the resulting span nests under the remote caller's span.
+func (t *Tracer) Extract(carrier map[string]string) *rcore.Context {
+	goCtx := t.prop.Extract(context.Background(), propagation.MapCarrier(carrier))
+
+	ctx := rcore.NewContext("")
+	ctx.Ctx = goCtx
+	ctx.Tracer = t
+	ctx.SetSpanContext(&spanState{goCtx: goCtx})
+	return ctx
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 Comcast Cable Communications Management, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// End Copyright
+
+package otel
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	rcore "github.com/decibelcooper/rulio/core"
+)
+
+func TestSubContextNestsUnderParentSpan(t *testing.T) {
+	tr := New(trace.NewNoopTracerProvider().Tracer("test"))
+
+	parent := rcore.NewContext("test")
+	parent.Tracer = tr
+
+	span := parent.StartSpan("parent-op")
+	defer span.StopSpan()
+
+	if span.SpanContext() == nil {
+		t.Fatalf("expected StartSpan to record a span context on ctx")
+	}
+
+	// A plain SubContext, taken before any child StartSpan, must
+	// inherit the exact same span state as its parent so it would
+	// nest under the same span if stopped without starting its own.
+	child := span.SubContext()
+	if child.SpanContext() != span.SpanContext() {
+		t.Fatalf("expected SubContext to inherit the parent's span context")
+	}
+
+	// Starting a new span under the child must produce a distinct
+	// span context, parented to the one it inherited rather than
+	// starting a sibling of the root.
+	grandchild := child.StartSpan("child-op")
+	defer grandchild.StopSpan()
+	if grandchild.SpanContext() == nil {
+		t.Fatalf("expected nested StartSpan to record its own span context")
+	}
+	if grandchild.SpanContext() == span.SpanContext() {
+		t.Fatalf("expected nested StartSpan to create a new span, not reuse the parent's")
+	}
+}
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	tr := New(trace.NewNoopTracerProvider().Tracer("test"))
+
+	outbound := rcore.NewContext("test")
+	outbound.Tracer = tr
+	span := outbound.StartSpan("outbound-call")
+	defer span.StopSpan()
+
+	carrier := make(map[string]string)
+	span.InjectTraceHeaders(carrier)
+
+	// Extract must succeed and hand back a Context that a receiving
+	// process can immediately StartSpan a child span under, even when
+	// (as with a no-op tracer) the carrier ends up empty.
+	inbound := tr.Extract(carrier)
+	if inbound.Tracer == nil {
+		t.Fatalf("expected Extract to set a Tracer on the returned Context")
+	}
+
+	received := inbound.StartSpan("inbound-handler")
+	defer received.StopSpan()
+	if received.SpanContext() == nil {
+		t.Fatalf("expected StartSpan after Extract to record a span context")
+	}
+}